@@ -15,6 +15,7 @@
 package atomicpaths
 
 import (
+	"context"
 	"errors"
 	"io/fs"
 	"os"
@@ -37,6 +38,7 @@ func dirCloseUncommitted(d *Dir) error {
 type Dir struct {
 	tempPath, origPath string
 
+	perm        fs.FileMode
 	closeFn     func(f *Dir) error
 	isCommitted bool
 }
@@ -55,11 +57,23 @@ func (d *Dir) Close() error { return d.closeFn(d) }
 // deleting the original path, if necessary, and moving the temporary
 // directory to the original's path location.
 func (d *Dir) Commit() error {
+	return d.CommitContext(context.Background())
+}
+
+// CommitContext is Commit, but checks ctx before each rename and before
+// walking the displaced original directory to clean it up, returning
+// ctx.Err() once ctx is done instead of continuing. If ctx is done
+// before anything was renamed, the Dir is unchanged and a later Commit
+// finishes the job. If ctx is done after the original was swapped aside,
+// the original is left under its temporary name; if it is done while that
+// original is being cleaned up, the new directory is already in place at
+// OriginalPath, the Dir is not marked committed and a later Commit fails.
+func (d *Dir) CommitContext(ctx context.Context) error {
 	if d.isCommitted {
 		return ErrCommitted
 	}
 
-	if err := move(d.Name(), d.OriginalPath()); err != nil {
+	if err := moveContext(ctx, d.Name(), d.OriginalPath()); err != nil {
 		return err
 	}
 	d.closeFn = dirCloseCommitted
@@ -67,8 +81,20 @@ func (d *Dir) Commit() error {
 	return nil
 }
 
+// CreateDir creates a temporary directory that can be either atomically
+// committed to the given path or discarded.
 func CreateDir(origPath string, perm fs.FileMode) (*Dir, error) {
+	return CreateDirContext(context.Background(), origPath, perm)
+}
+
+// CreateDirContext is CreateDir, but aborts the temporary-name retry
+// loop and returns ctx.Err() once ctx is done.
+func CreateDirContext(ctx context.Context, origPath string, perm fs.FileMode) (*Dir, error) {
 	for i := 0; i < 1000; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		tempPath, err := makeTempPath(origPath)
 		if err != nil {
 			return nil, err
@@ -85,6 +111,7 @@ func CreateDir(origPath string, perm fs.FileMode) (*Dir, error) {
 			closeFn:  dirCloseUncommitted,
 			tempPath: tempPath,
 			origPath: origPath,
+			perm:     perm,
 		}, nil
 	}
 	return nil, ErrExhausted
@@ -0,0 +1,116 @@
+// Copyright 2022 individual contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// <https://www.apache.org/licenses/LICENSE-2.0>
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package atomicpaths
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// MergeOptions controls Dir.CommitMerge.
+type MergeOptions struct {
+	// IgnoreExisting lists paths, relative to the staged directory's
+	// root, that should be left as-is at the destination even though
+	// the staged tree also has them.
+	IgnoreExisting []string
+}
+
+// CommitMerge commits d by overlaying its staged files onto the
+// existing directory at OriginalPath, rather than replacing the whole
+// tree the way Commit does. Every staged file is individually renamed
+// over its counterpart below OriginalPath using the same rename-to-temp
+// fallback Commit relies on, so a crash partway through a merge still
+// leaves every file it has not gotten to yet recoverable. This is meant
+// for updating a handful of files under a directory shared with
+// readers, e.g. writing a single new certificate into an existing
+// account directory, without racing readers of unrelated siblings.
+//
+// Unlike Commit, CommitMerge never removes a destination file that has
+// no counterpart in the staged tree, and it leaves any path listed in
+// opts.IgnoreExisting untouched even if the staged tree has it. Only
+// OriginalPath itself is fsynced once after every file has been placed;
+// it does not recursively fsync new subdirectories the merge created
+// below it, so durability of a merge that introduces new nested
+// directories is best-effort.
+func (d *Dir) CommitMerge(opts MergeOptions) error {
+	return d.CommitMergeContext(context.Background(), opts)
+}
+
+// CommitMergeContext is CommitMerge, but checks ctx before placing each
+// staged file and returns ctx.Err() once ctx is done instead of placing
+// the next one.
+func (d *Dir) CommitMergeContext(ctx context.Context, opts MergeOptions) error {
+	if d.isCommitted {
+		return ErrCommitted
+	}
+
+	ignore := make(map[string]bool, len(opts.IgnoreExisting))
+	for _, p := range opts.IgnoreExisting {
+		ignore[filepath.Clean(p)] = true
+	}
+
+	if err := os.MkdirAll(d.OriginalPath(), d.perm); err != nil {
+		return err
+	}
+
+	err := filepath.WalkDir(d.Name(), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(d.Name(), path)
+		if err != nil {
+			return err
+		}
+		if ignore[rel] {
+			return nil
+		}
+
+		destPath := filepath.Join(d.OriginalPath(), rel)
+		if err := os.MkdirAll(filepath.Dir(destPath), d.perm); err != nil {
+			return err
+		}
+
+		return moveContext(ctx, path, destPath)
+	})
+	if err != nil {
+		return err
+	}
+
+	parent, err := openParent(d.OriginalPath())
+	if err != nil {
+		return err
+	}
+	if err := parent.fsync(); err != nil {
+		_ = parent.close()
+		return err
+	}
+	if err := parent.close(); err != nil {
+		return err
+	}
+
+	d.closeFn = dirCloseCommitted
+	d.isCommitted = true
+
+	return os.RemoveAll(d.Name())
+}
@@ -0,0 +1,116 @@
+// Copyright 2022 individual contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// <https://www.apache.org/licenses/LICENSE-2.0>
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package atomicpaths_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	requirepkg "github.com/stretchr/testify/require"
+
+	"github.com/aezhar/atomicpaths"
+)
+
+func TestDirCommitMerge(t *testing.T) {
+	require := requirepkg.New(t)
+
+	origPath := filepath.Join(t.TempDir(), "account")
+	require.NoError(os.MkdirAll(origPath, 0o700))
+	require.NoError(os.WriteFile(filepath.Join(origPath, "existing.txt"), []byte("keep me"), 0o600))
+
+	d, err := atomicpaths.CreateDir(origPath, 0o700)
+	require.NoError(err)
+	require.NoError(os.WriteFile(filepath.Join(d.Name(), "cert.pem"), []byte("new cert"), 0o600))
+
+	require.NoError(d.CommitMerge(atomicpaths.MergeOptions{}))
+
+	// The pre-existing file is left alone ...
+	content, err := os.ReadFile(filepath.Join(origPath, "existing.txt"))
+	require.NoError(err)
+	require.Equal([]byte("keep me"), content)
+
+	// ... and the staged file has been placed alongside it.
+	content, err = os.ReadFile(filepath.Join(origPath, "cert.pem"))
+	require.NoError(err)
+	require.Equal([]byte("new cert"), content)
+}
+
+func TestDirCommitMergeIgnoreExisting(t *testing.T) {
+	require := requirepkg.New(t)
+
+	origPath := filepath.Join(t.TempDir(), "account")
+	require.NoError(os.MkdirAll(origPath, 0o700))
+	require.NoError(os.WriteFile(filepath.Join(origPath, "cert.pem"), []byte("old cert"), 0o600))
+
+	d, err := atomicpaths.CreateDir(origPath, 0o700)
+	require.NoError(err)
+	require.NoError(os.WriteFile(filepath.Join(d.Name(), "cert.pem"), []byte("new cert"), 0o600))
+
+	require.NoError(d.CommitMerge(atomicpaths.MergeOptions{
+		IgnoreExisting: []string{"cert.pem"},
+	}))
+
+	content, err := os.ReadFile(filepath.Join(origPath, "cert.pem"))
+	require.NoError(err)
+	require.Equal([]byte("old cert"), content)
+}
+
+func TestDirCommitMergeNestedSubdirectory(t *testing.T) {
+	require := requirepkg.New(t)
+
+	origPath := filepath.Join(t.TempDir(), "account")
+	require.NoError(os.MkdirAll(origPath, 0o700))
+
+	d, err := atomicpaths.CreateDir(origPath, 0o700)
+	require.NoError(err)
+
+	nested := filepath.Join(d.Name(), "certs", "live")
+	require.NoError(os.MkdirAll(nested, 0o700))
+	require.NoError(os.WriteFile(filepath.Join(nested, "cert.pem"), []byte("new cert"), 0o600))
+
+	require.NoError(d.CommitMerge(atomicpaths.MergeOptions{}))
+
+	content, err := os.ReadFile(filepath.Join(origPath, "certs", "live", "cert.pem"))
+	require.NoError(err)
+	require.Equal([]byte("new cert"), content)
+}
+
+func TestDirCommitMergeContextCancelled(t *testing.T) {
+	require := requirepkg.New(t)
+
+	origPath := filepath.Join(t.TempDir(), "account")
+	require.NoError(os.MkdirAll(origPath, 0o700))
+	require.NoError(os.WriteFile(filepath.Join(origPath, "existing.txt"), []byte("keep me"), 0o600))
+
+	d, err := atomicpaths.CreateDir(origPath, 0o700)
+	require.NoError(err)
+	require.NoError(os.WriteFile(filepath.Join(d.Name(), "cert.pem"), []byte("new cert"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.ErrorIs(d.CommitMergeContext(ctx, atomicpaths.MergeOptions{}), context.Canceled)
+
+	// Nothing was placed yet: the staged file has not been merged in.
+	require.NoFileExists(filepath.Join(origPath, "cert.pem"))
+
+	// The Dir is left resumable: a plain CommitMerge finishes the job.
+	require.NoError(d.CommitMerge(atomicpaths.MergeOptions{}))
+	content, err := os.ReadFile(filepath.Join(origPath, "cert.pem"))
+	require.NoError(err)
+	require.Equal([]byte("new cert"), content)
+}
@@ -15,6 +15,7 @@
 package atomicpaths_test
 
 import (
+	"context"
 	"io/fs"
 	"os"
 	"testing"
@@ -87,3 +88,57 @@ func TestCreateDir_CommitNew(t *testing.T) {
 		})
 	}
 }
+
+func TestDirCommitReplacesExistingNonEmptyDirectory(t *testing.T) {
+	require := requirepkg.New(t)
+
+	tempDir := t.TempDir() + "/dirname"
+
+	// Given an existing, non-empty directory at the original path ...
+	require.NoError(os.MkdirAll(tempDir, 0700))
+	require.NoError(os.WriteFile(tempDir+"/old", []byte("old"), 0600))
+
+	d, err := atomicpaths.CreateDir(tempDir, 0700)
+	require.NoError(err)
+	require.NoError(os.WriteFile(d.Name()+"/new", []byte("new"), 0600))
+
+	// ... Commit must swap the original aside (so the rename into place
+	// doesn't fail with the directory-not-empty error the OS reports for
+	// a rename onto an existing, non-empty directory) and then discard
+	// it.
+	require.NoError(d.Commit())
+
+	require.FileExists(tempDir + "/new")
+	require.NoFileExists(tempDir + "/old")
+}
+
+func TestCreateDirContextCancelled(t *testing.T) {
+	require := requirepkg.New(t)
+
+	tempDir := t.TempDir() + "/dirname"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := atomicpaths.CreateDirContext(ctx, tempDir, 0700)
+	require.ErrorIs(err, context.Canceled)
+	require.NoDirExists(tempDir)
+}
+
+func TestDirCommitContextCancelled(t *testing.T) {
+	require := requirepkg.New(t)
+
+	tempDir := t.TempDir() + "/dirname"
+
+	d, err := atomicpaths.CreateDir(tempDir, 0700)
+	require.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.ErrorIs(d.CommitContext(ctx), context.Canceled)
+	require.NoDirExists(tempDir)
+
+	require.NoError(d.Commit())
+	require.DirExists(tempDir)
+}
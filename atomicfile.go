@@ -1,26 +1,35 @@
 package atomicpaths
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
-
-	"go.uber.org/multierr"
-	"golang.org/x/sys/unix"
 )
 
+// parentDir abstracts the operations File needs to perform against the
+// directory a file is being committed into: renaming the temporary file
+// over the original, making sure that rename is durable, and releasing
+// whatever handle was used to do so. The unix implementation backs this
+// with an open directory descriptor so it can fsync it directly; other
+// platforms fall back to a plain path-based rename.
+type parentDir interface {
+	rename(oldName, newName string) error
+	fsync() error
+	close() error
+}
+
 // File represents a temporary file that on success can be "committed"
 // to the provided path and rolled back otherwise.
 type File struct {
 	*os.File
 
 	closeFn  func() error
-	commitFn func() error
+	commitFn func(ctx context.Context) error
 
 	origPath string
-	parentFd int
+	parent   parentDir
 	state    state
 }
 
@@ -33,74 +42,67 @@ func (f *File) closeCommitted() error {
 	return nil
 }
 
-func (f *File) closeUncommitted() (err error) {
+func (f *File) closeUncommitted() error {
 	f.closeFn = f.closeAgainError
 	f.commitFn = f.commitClosed
 
-	if !f.state.is(closed) {
-		multierr.AppendInto(&err, f.File.Close())
-		f.state.set(closed)
-	}
-
-	if !f.state.is(placed) {
-		multierr.AppendInto(&err, os.Remove(f.Name()))
-		f.state.set(placed)
-	}
-
-	if !f.state.is(synced) {
-		multierr.AppendInto(&err, unix.Close(f.parentFd))
-		f.state.set(synced)
-	}
-
-	return
+	return runCloseSteps(&f.state, []commitStep{
+		{closed, f.File.Close},
+		{placed, func() error { return os.Remove(f.Name()) }},
+		{synced, f.parent.close},
+	})
 }
 
-func (f *File) commitClosed() error {
+func (f *File) commitClosed(ctx context.Context) error {
 	return ErrRolledBack
 }
 
-func (f *File) commitCommitted() error {
+func (f *File) commitCommitted(ctx context.Context) error {
 	return ErrAlreadyCommitted
 }
 
-func (f *File) commitUncommitted() error {
-	if !f.state.is(closed) {
-		if err := f.File.Sync(); err != nil {
-			return fmt.Errorf("atomicpaths.commit: %w", err)
-		}
-		if err := f.File.Close(); err != nil {
-			return fmt.Errorf("atomicpaths.commit: %w", err)
-		}
-
-		f.state.set(closed)
-	}
-
-	if !f.state.is(placed) {
-		oldName := filepath.Base(f.Name())
-		newName := filepath.Base(f.OriginalPath())
-		if err := rename(f.parentFd, oldName, newName); err != nil {
-			return fmt.Errorf("atomicpaths.commit: %w", err)
-		}
-
-		f.state.set(placed)
-	}
-
-	if !f.state.is(synced) {
-		if err := unix.Fsync(f.parentFd); err != nil {
-			err = &fs.PathError{Op: "sync", Path: filepath.Dir(f.Name()), Err: err}
-			return fmt.Errorf("atomicpaths.commit: %w", err)
-		}
-		if err := unix.Close(f.parentFd); err != nil {
-			err = &fs.PathError{Op: "close", Path: filepath.Dir(f.Name()), Err: err}
-			return fmt.Errorf("atomicpaths.commit: %w", err)
-		}
-		f.closeFn = f.closeCommitted
-		f.commitFn = f.commitCommitted
-
-		f.state.set(synced)
-	}
-
-	return nil
+func (f *File) commitUncommitted(ctx context.Context) error {
+	return runCommitSteps(&f.state, []commitStep{
+		{closed, func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := f.File.Sync(); err != nil {
+				return fmt.Errorf("atomicpaths.commit: %w", err)
+			}
+			if err := f.File.Close(); err != nil {
+				return fmt.Errorf("atomicpaths.commit: %w", err)
+			}
+			return nil
+		}},
+		{placed, func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			oldName := filepath.Base(f.Name())
+			newName := filepath.Base(f.OriginalPath())
+			if err := f.parent.rename(oldName, newName); err != nil {
+				return fmt.Errorf("atomicpaths.commit: %w", err)
+			}
+			return nil
+		}},
+		{synced, func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := f.parent.fsync(); err != nil {
+				err = &fs.PathError{Op: "sync", Path: filepath.Dir(f.Name()), Err: err}
+				return fmt.Errorf("atomicpaths.commit: %w", err)
+			}
+			if err := f.parent.close(); err != nil {
+				err = &fs.PathError{Op: "close", Path: filepath.Dir(f.Name()), Err: err}
+				return fmt.Errorf("atomicpaths.commit: %w", err)
+			}
+			f.closeFn = f.closeCommitted
+			f.commitFn = f.commitCommitted
+			return nil
+		}},
+	})
 }
 
 // OriginalPath returns the path to the original file.
@@ -114,6 +116,15 @@ func (f *File) Close() error {
 	return f.closeFn()
 }
 
+// Cancel abandons the write, discarding the temporary file. It is
+// equivalent to Close on an uncommitted File, but makes the intent
+// explicit for callers that want to give up on a write after an error
+// without having to reach into unexported state to tell "abandon" apart
+// from "release resources after a successful Commit".
+func (f *File) Cancel() error {
+	return f.Close()
+}
+
 // Commit flushes all unwritten changes to disk, closes the underlying
 // temporary file, making it impossible to apply any changes, and
 // commits the temporary file to the original path.
@@ -122,47 +133,26 @@ func (f *File) Close() error {
 // the returned problem and try again until the changes have been
 // committed successfully or abandoned.
 func (f *File) Commit() error {
-	return f.commitFn()
+	return f.commitFn(context.Background())
+}
+
+// CommitContext is Commit, but checks ctx before each remaining step
+// (the fsync, the rename, the directory fsync) and returns ctx.Err()
+// instead of starting the next one once ctx is done. Because Commit can
+// be resumed, a File whose CommitContext was cancelled mid-flight can be
+// finished later with another Commit or CommitContext call.
+func (f *File) CommitContext(ctx context.Context) error {
+	return f.commitFn(ctx)
 }
 
 // CreateFile creates a temporary file that can be either atomically
 // committed to the given path or discarded.
 func CreateFile(origPath string, perm os.FileMode) (*File, error) {
-	parentPath := filepath.Dir(origPath)
-
-	parentFd, err := openParent(parentPath)
-	if err != nil {
-		return nil, err
-	}
-
-	origName := filepath.Base(origPath)
-	for i := 0; i < 1000; i++ {
-		tempName, err := makeTempName(origName)
-		if err != nil {
-			return nil, err
-		}
-
-		flags := unix.O_RDWR
-		flags |= unix.O_CREAT
-		flags |= unix.O_EXCL
-		flags |= unix.O_CLOEXEC
-		fileFd, err := unix.Openat(parentFd, tempName, flags, uint32(perm))
-		if err != nil {
-			if errors.Is(err, fs.ErrExist) {
-				continue
-			}
-			return nil, err
-		}
-
-		tempPath := filepath.Join(parentPath, tempName)
-		af := &File{
-			File:     os.NewFile(uintptr(fileFd), tempPath),
-			parentFd: parentFd,
-			origPath: origPath,
-		}
-		af.closeFn = af.closeUncommitted
-		af.commitFn = af.commitUncommitted
-		return af, nil
-	}
-	return nil, ErrExhausted
+	return CreateFileContext(context.Background(), origPath, perm)
+}
+
+// CreateFileContext is CreateFile, but aborts the temporary-name retry
+// loop and returns ctx.Err() once ctx is done.
+func CreateFileContext(ctx context.Context, origPath string, perm os.FileMode) (*File, error) {
+	return createFile(ctx, origPath, perm)
 }
@@ -0,0 +1,98 @@
+// Copyright 2022 individual contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// <https://www.apache.org/licenses/LICENSE-2.0>
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build !unix
+
+package atomicpaths
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// portableParentDir backs parentDir on platforms without an
+// open-directory-descriptor primitive, namely Windows and plan9. Renames
+// go through os.Rename, which on Windows is implemented with MoveFileEx
+// and MOVEFILE_REPLACE_EXISTING and so already replaces the destination
+// atomically; there is no portable way to fsync a directory, so fsync is
+// a no-op and durability of the rename itself is left to the OS.
+type portableParentDir struct {
+	path string
+}
+
+func openParent(path string) (*portableParentDir, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: errors.New("not a directory")}
+	}
+	return &portableParentDir{path: path}, nil
+}
+
+func (d *portableParentDir) rename(oldName, newName string) error {
+	return os.Rename(filepath.Join(d.path, oldName), filepath.Join(d.path, newName))
+}
+
+func (d *portableParentDir) fsync() error {
+	return nil
+}
+
+func (d *portableParentDir) close() error {
+	return nil
+}
+
+func createFile(ctx context.Context, origPath string, perm os.FileMode) (*File, error) {
+	parentPath := filepath.Dir(origPath)
+
+	parent, err := openParent(parentPath)
+	if err != nil {
+		return nil, err
+	}
+
+	origName := filepath.Base(origPath)
+	for i := 0; i < 1000; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		tempName, err := makeTempName(origName)
+		if err != nil {
+			return nil, err
+		}
+
+		tempPath := filepath.Join(parentPath, tempName)
+		fh, err := os.OpenFile(tempPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if err != nil {
+			if errors.Is(err, fs.ErrExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		af := &File{
+			File:     fh,
+			parent:   parent,
+			origPath: origPath,
+		}
+		af.closeFn = af.closeUncommitted
+		af.commitFn = af.commitUncommitted
+		return af, nil
+	}
+	return nil, ErrExhausted
+}
@@ -1,6 +1,9 @@
 package atomicpaths_test
 
 import (
+	"context"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -87,3 +90,82 @@ func TestFileRollback(t *testing.T) {
 	// original path.
 	require.NoFileExists(p)
 }
+
+func TestFileCancel(t *testing.T) {
+	require := requirePkg.New(t)
+
+	p := filepath.Join(t.TempDir(), "foo")
+
+	f, err := atomicpaths.CreateFile(p, 0o666)
+	require.NoError(err)
+
+	_, err = f.WriteString("Hello World!\n")
+	require.NoError(err)
+
+	require.NoError(f.Cancel())
+
+	// Cancelling the write should behave like Close: the temporary
+	// file is discarded and the original path is left untouched.
+	require.NoFileExists(p)
+}
+
+func TestWriteFile(t *testing.T) {
+	require := requirePkg.New(t)
+
+	p := filepath.Join(t.TempDir(), "foo")
+
+	require.NoError(atomicpaths.WriteFile(p, []byte("Hello World!\n"), 0o666))
+
+	content, err := os.ReadFile(p)
+	require.NoError(err)
+	require.Equal([]byte("Hello World!\n"), content)
+}
+
+func TestCreateFileContextCancelled(t *testing.T) {
+	require := requirePkg.New(t)
+
+	p := filepath.Join(t.TempDir(), "foo")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := atomicpaths.CreateFileContext(ctx, p, 0o666)
+	require.ErrorIs(err, context.Canceled)
+	require.NoFileExists(p)
+}
+
+func TestCommitContextCancelled(t *testing.T) {
+	require := requirePkg.New(t)
+
+	p := filepath.Join(t.TempDir(), "foo")
+
+	f, err := atomicpaths.CreateFile(p, 0o666)
+	require.NoError(err)
+
+	_, err = f.WriteString("Hello World!\n")
+	require.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.ErrorIs(f.CommitContext(ctx), context.Canceled)
+	require.NoFileExists(p)
+
+	// The File is left resumable: a plain Commit finishes the job.
+	require.NoError(f.Commit())
+	require.FileExists(p)
+}
+
+func TestReplaceFileRollsBackOnError(t *testing.T) {
+	require := requirePkg.New(t)
+
+	p := filepath.Join(t.TempDir(), "foo")
+
+	boom := errors.New("boom")
+	err := atomicpaths.ReplaceFile(p, 0o666, func(w io.Writer) error {
+		return boom
+	})
+	require.ErrorIs(err, boom)
+
+	require.NoFileExists(p)
+}
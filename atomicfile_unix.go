@@ -0,0 +1,109 @@
+// Copyright 2022 individual contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// <https://www.apache.org/licenses/LICENSE-2.0>
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build unix
+
+package atomicpaths
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// unixParentDir backs parentDir with an open directory descriptor, so
+// the rename into place and the following fsync can be issued against
+// the same fd without racing a path-based lookup.
+type unixParentDir struct {
+	fd int
+}
+
+func openParent(path string) (*unixParentDir, error) {
+	flags := unix.O_RDONLY
+	flags |= unix.O_DIRECTORY
+	flags |= unix.O_CLOEXEC
+	fd, err := unix.Open(path, flags, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &unixParentDir{fd: fd}, nil
+}
+
+func (d *unixParentDir) rename(oldName, newName string) error {
+	return unix.Renameat(d.fd, oldName, d.fd, newName)
+}
+
+func (d *unixParentDir) fsync() error {
+	return unix.Fsync(d.fd)
+}
+
+func (d *unixParentDir) close() error {
+	return unix.Close(d.fd)
+}
+
+func createFile(ctx context.Context, origPath string, perm os.FileMode) (*File, error) {
+	parentPath := filepath.Dir(origPath)
+
+	parent, err := openParent(parentPath)
+	if err != nil {
+		return nil, err
+	}
+
+	placed := false
+	defer func() {
+		if !placed {
+			_ = parent.close()
+		}
+	}()
+
+	origName := filepath.Base(origPath)
+	for i := 0; i < 1000; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		tempName, err := makeTempName(origName)
+		if err != nil {
+			return nil, err
+		}
+
+		flags := unix.O_RDWR
+		flags |= unix.O_CREAT
+		flags |= unix.O_EXCL
+		flags |= unix.O_CLOEXEC
+		fileFd, err := unix.Openat(parent.fd, tempName, flags, uint32(perm))
+		if err != nil {
+			if errors.Is(err, fs.ErrExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		tempPath := filepath.Join(parentPath, tempName)
+		af := &File{
+			File:     os.NewFile(uintptr(fileFd), tempPath),
+			parent:   parent,
+			origPath: origPath,
+		}
+		af.closeFn = af.closeUncommitted
+		af.commitFn = af.commitUncommitted
+		placed = true
+		return af, nil
+	}
+	return nil, ErrExhausted
+}
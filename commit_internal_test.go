@@ -0,0 +1,51 @@
+package atomicpaths
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	requirePkg "github.com/stretchr/testify/require"
+)
+
+// flakyParentDir wraps a real parentDir but forces fsync to fail, so tests
+// can reproduce a Commit that renames the temporary file into place and
+// then fails on the trailing directory fsync.
+type flakyParentDir struct {
+	parentDir
+	fsyncErr error
+}
+
+func (p *flakyParentDir) fsync() error {
+	return p.fsyncErr
+}
+
+func TestCommitFailureAfterRenameLeavesDataInPlace(t *testing.T) {
+	require := requirePkg.New(t)
+
+	p := filepath.Join(t.TempDir(), "foo")
+
+	f, err := CreateFile(p, 0o666)
+	require.NoError(err)
+
+	_, err = f.WriteString("Hello World!\n")
+	require.NoError(err)
+
+	boom := errors.New("boom")
+	f.parent = &flakyParentDir{parentDir: f.parent, fsyncErr: boom}
+
+	require.ErrorIs(f.Commit(), boom)
+
+	// The rename has already happened: the new content is live at p,
+	// even though Commit reported an error.
+	content, err := os.ReadFile(p)
+	require.NoError(err)
+	require.Equal([]byte("Hello World!\n"), content)
+
+	// ReplaceFile and CopyFileOpts rely on Close, not Cancel, being the
+	// right way to release resources at this point: it must not remove
+	// what Commit already placed.
+	require.NoError(f.Close())
+	require.FileExists(p)
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 individual contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// <https://www.apache.org/licenses/LICENSE-2.0>
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package atomicpaths
+
+import (
+	"io"
+	"os"
+
+	"go.uber.org/multierr"
+)
+
+// CopyOptions controls what metadata CopyFile carries over from src to
+// dst in addition to its content.
+type CopyOptions struct {
+	// PreserveMode carries src's permission bits over to dst regardless
+	// of the perm passed to CopyFileOpts, the same way perm == 0 already
+	// does.
+	PreserveMode bool
+
+	// PreserveOwner carries the uid and gid of src over to dst. It is a
+	// no-op on platforms that have no concept of a file owner.
+	PreserveOwner bool
+}
+
+// CopyFile atomically replaces dst with the contents of src, preserving
+// src's permission bits when perm is 0.
+func CopyFile(dst, src string, perm os.FileMode) error {
+	return CopyFileOpts(dst, src, perm, CopyOptions{})
+}
+
+// CopyFileOpts is CopyFile with additional metadata to preserve from
+// src, as controlled by opts.
+func CopyFileOpts(dst, src string, perm os.FileMode, opts CopyOptions) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	if perm == 0 || opts.PreserveMode {
+		perm = fi.Mode().Perm()
+	}
+
+	f, err := CreateFile(dst, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, in); err != nil {
+		return multierr.Append(err, f.Cancel())
+	}
+
+	if opts.PreserveOwner {
+		if err := preserveOwner(f, fi); err != nil {
+			return multierr.Append(err, f.Cancel())
+		}
+	}
+
+	if err := f.Commit(); err != nil {
+		// See ReplaceFile: once Commit has renamed the temporary file
+		// into place, only Close, not Cancel, is appropriate — the
+		// new content is already live at dst.
+		if f.state.is(placed) {
+			return multierr.Append(err, f.Close())
+		}
+		return multierr.Append(err, f.Cancel())
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,25 @@
+// Copyright 2022 individual contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// <https://www.apache.org/licenses/LICENSE-2.0>
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build !unix
+
+package atomicpaths
+
+import "os"
+
+// preserveOwner is a no-op: platforms without unix-style file ownership
+// have nothing for CopyOptions.PreserveOwner to carry over.
+func preserveOwner(f *File, fi os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 individual contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// <https://www.apache.org/licenses/LICENSE-2.0>
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package atomicpaths_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	requirePkg "github.com/stretchr/testify/require"
+
+	"github.com/aezhar/atomicpaths"
+)
+
+func TestCopyFile(t *testing.T) {
+	require := requirePkg.New(t)
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+
+	require.NoError(os.WriteFile(src, []byte("Hello World!\n"), 0o600))
+
+	require.NoError(atomicpaths.CopyFile(dst, src, 0o644))
+
+	content, err := os.ReadFile(dst)
+	require.NoError(err)
+	require.Equal([]byte("Hello World!\n"), content)
+
+	fi, err := os.Stat(dst)
+	require.NoError(err)
+	require.Equal(os.FileMode(0o644), fi.Mode().Perm())
+}
+
+func TestCopyFilePreservesModeWhenPermIsZero(t *testing.T) {
+	require := requirePkg.New(t)
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+
+	require.NoError(os.WriteFile(src, []byte("Hello World!\n"), 0o640))
+
+	require.NoError(atomicpaths.CopyFile(dst, src, 0))
+
+	fi, err := os.Stat(dst)
+	require.NoError(err)
+	require.Equal(os.FileMode(0o640), fi.Mode().Perm())
+}
+
+func TestCopyFileOptsPreserveModeOverridesPerm(t *testing.T) {
+	require := requirePkg.New(t)
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+
+	require.NoError(os.WriteFile(src, []byte("Hello World!\n"), 0o640))
+
+	require.NoError(atomicpaths.CopyFileOpts(dst, src, 0o644, atomicpaths.CopyOptions{PreserveMode: true}))
+
+	fi, err := os.Stat(dst)
+	require.NoError(err)
+	require.Equal(os.FileMode(0o640), fi.Mode().Perm())
+}
+
+func TestCopyFileMissingSource(t *testing.T) {
+	require := requirePkg.New(t)
+
+	dir := t.TempDir()
+
+	err := atomicpaths.CopyFile(filepath.Join(dir, "dst"), filepath.Join(dir, "does-not-exist"), 0o644)
+	require.Error(err)
+	require.NoFileExists(filepath.Join(dir, "dst"))
+}
@@ -0,0 +1,246 @@
+// Copyright 2022 individual contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// <https://www.apache.org/licenses/LICENSE-2.0>
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build !plan9
+
+package atomicpaths
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// FS is the subset of afero.Fs that atomicpaths needs to stage and
+// commit files and directories. Every afero.Fs implementation satisfies
+// it as-is, so CreateFileFS/CreateDirFS work unmodified on top of
+// afero.NewMemMapFs (tests), afero.NewBasePathFs (chroots) or
+// afero.NewCopyOnWriteFs (overlays).
+//
+// This file, and CreateFileFS/CreateDirFS with it, is unavailable on
+// plan9: afero does not build there. CreateFile/CreateDir are unaffected
+// and keep working on plan9 through the portable fallback in
+// atomicfile_other.go.
+//
+// Unlike CreateFile, which owns an open directory descriptor on unix and
+// fsyncs it directly, an FS has no such primitive, so committing falls
+// back to a plain Rename.
+type FS interface {
+	OpenFile(name string, flag int, perm os.FileMode) (afero.File, error)
+	Mkdir(name string, perm os.FileMode) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	Rename(oldname, newname string) error
+}
+
+// GenericFile is the FS-backed counterpart of File. It follows the same
+// create-write-commit-or-cancel state machine, but commits with a single
+// Rename instead of a directory-fd based rename-then-fsync.
+type GenericFile struct {
+	afero.File
+
+	fsys     FS
+	closeFn  func() error
+	commitFn func() error
+	origPath string
+	state    state
+}
+
+func (f *GenericFile) closeAgainError() error {
+	return os.ErrInvalid
+}
+
+func (f *GenericFile) closeCommitted() error {
+	f.closeFn = f.closeAgainError
+	return nil
+}
+
+func (f *GenericFile) closeUncommitted() error {
+	f.closeFn = f.closeAgainError
+	f.commitFn = f.commitClosed
+
+	return runCloseSteps(&f.state, []commitStep{
+		{closed, f.File.Close},
+		{placed, func() error { return f.fsys.Remove(f.Name()) }},
+	})
+}
+
+func (f *GenericFile) commitClosed() error {
+	return ErrRolledBack
+}
+
+func (f *GenericFile) commitCommitted() error {
+	return ErrAlreadyCommitted
+}
+
+func (f *GenericFile) commitUncommitted() error {
+	return runCommitSteps(&f.state, []commitStep{
+		{closed, func() error {
+			if err := f.File.Sync(); err != nil {
+				return fmt.Errorf("atomicpaths.commit: %w", err)
+			}
+			if err := f.File.Close(); err != nil {
+				return fmt.Errorf("atomicpaths.commit: %w", err)
+			}
+			return nil
+		}},
+		{placed, func() error {
+			if err := f.fsys.Rename(f.Name(), f.OriginalPath()); err != nil {
+				return fmt.Errorf("atomicpaths.commit: %w", err)
+			}
+			f.closeFn = f.closeCommitted
+			f.commitFn = f.commitCommitted
+			return nil
+		}},
+	})
+}
+
+// OriginalPath returns the path to the original file.
+func (f *GenericFile) OriginalPath() string {
+	return f.origPath
+}
+
+// Close closes the GenericFile instance, removing any uncommitted
+// temporary files.
+func (f *GenericFile) Close() error {
+	return f.closeFn()
+}
+
+// Cancel abandons the write, discarding the temporary file. See
+// File.Cancel.
+func (f *GenericFile) Cancel() error {
+	return f.Close()
+}
+
+// Commit renames the temporary file to the original path on fsys.
+//
+// Commit can be called repeatedly in case of an error to resolve
+// the returned problem and try again until the changes have been
+// committed successfully or abandoned.
+func (f *GenericFile) Commit() error {
+	return f.commitFn()
+}
+
+// CreateFileFS creates a temporary file on fsys that can be either
+// atomically committed to the given path or discarded.
+func CreateFileFS(fsys FS, origPath string, perm os.FileMode) (*GenericFile, error) {
+	parentPath := filepath.Dir(origPath)
+	origName := filepath.Base(origPath)
+
+	for i := 0; i < 1000; i++ {
+		tempName, err := makeTempName(origName)
+		if err != nil {
+			return nil, err
+		}
+
+		tempPath := filepath.Join(parentPath, tempName)
+		fh, err := fsys.OpenFile(tempPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if err != nil {
+			if errors.Is(err, fs.ErrExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		gf := &GenericFile{
+			File:     fh,
+			fsys:     fsys,
+			origPath: origPath,
+		}
+		gf.closeFn = gf.closeUncommitted
+		gf.commitFn = gf.commitUncommitted
+		return gf, nil
+	}
+	return nil, ErrExhausted
+}
+
+func genericDirCloseAgainError(d *GenericDir) error { return os.ErrInvalid }
+
+func genericDirCloseCommitted(d *GenericDir) error {
+	d.closeFn = genericDirCloseAgainError
+	return nil
+}
+
+func genericDirCloseUncommitted(d *GenericDir) error {
+	d.closeFn = genericDirCloseAgainError
+	return d.fsys.RemoveAll(d.tempPath)
+}
+
+// GenericDir is the FS-backed counterpart of Dir. Unlike Dir, which
+// swaps the original directory aside so it can be recovered if the
+// process is interrupted between the two renames, GenericDir commits
+// with a single Rename on fsys; the recovery dance in move works through
+// os directly and is not used here.
+type GenericDir struct {
+	tempPath, origPath string
+
+	fsys        FS
+	closeFn     func(d *GenericDir) error
+	isCommitted bool
+}
+
+// Name returns the path to the temporary directory to be modified.
+func (d *GenericDir) Name() string { return d.tempPath }
+
+// OriginalPath returns the path to the original directory.
+func (d *GenericDir) OriginalPath() string { return d.origPath }
+
+// Close closes the GenericDir instance, removing any uncommitted
+// temporary files.
+func (d *GenericDir) Close() error { return d.closeFn(d) }
+
+// Commit commits the temporary directory to the original path by
+// renaming it into place on fsys.
+func (d *GenericDir) Commit() error {
+	if d.isCommitted {
+		return ErrCommitted
+	}
+
+	if err := d.fsys.Rename(d.Name(), d.OriginalPath()); err != nil {
+		return err
+	}
+	d.closeFn = genericDirCloseCommitted
+	d.isCommitted = true
+	return nil
+}
+
+// CreateDirFS creates a temporary directory on fsys that can be either
+// atomically committed to the given path or discarded.
+func CreateDirFS(fsys FS, origPath string, perm fs.FileMode) (*GenericDir, error) {
+	for i := 0; i < 1000; i++ {
+		tempPath, err := makeTempPath(origPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := fsys.Mkdir(tempPath, perm); err != nil {
+			if errors.Is(err, fs.ErrExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		return &GenericDir{
+			closeFn:  genericDirCloseUncommitted,
+			tempPath: tempPath,
+			origPath: origPath,
+			fsys:     fsys,
+		}, nil
+	}
+	return nil, ErrExhausted
+}
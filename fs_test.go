@@ -0,0 +1,74 @@
+// Copyright 2022 individual contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// <https://www.apache.org/licenses/LICENSE-2.0>
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build !plan9
+
+package atomicpaths_test
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	requirePkg "github.com/stretchr/testify/require"
+
+	"github.com/aezhar/atomicpaths"
+)
+
+func TestCreateFileFS(t *testing.T) {
+	require := requirePkg.New(t)
+
+	fsys := afero.NewMemMapFs()
+	require.NoError(fsys.MkdirAll("/tmp", 0o755))
+
+	f, err := atomicpaths.CreateFileFS(fsys, "/tmp/foo", 0o666)
+	require.NoError(err)
+
+	exists, err := afero.Exists(fsys, "/tmp/foo")
+	require.NoError(err)
+	require.False(exists)
+
+	_, err = f.WriteString("Hello World!\n")
+	require.NoError(err)
+
+	require.NoError(f.Commit())
+
+	content, err := afero.ReadFile(fsys, "/tmp/foo")
+	require.NoError(err)
+	require.Equal([]byte("Hello World!\n"), content)
+
+	require.NoError(f.Close())
+}
+
+func TestCreateDirFS(t *testing.T) {
+	require := requirePkg.New(t)
+
+	fsys := afero.NewMemMapFs()
+	require.NoError(fsys.MkdirAll("/tmp", 0o755))
+
+	d, err := atomicpaths.CreateDirFS(fsys, "/tmp/dirname", 0o700)
+	require.NoError(err)
+
+	exists, err := afero.DirExists(fsys, "/tmp/dirname")
+	require.NoError(err)
+	require.False(exists)
+
+	require.NoError(d.Commit())
+
+	exists, err = afero.DirExists(fsys, "/tmp/dirname")
+	require.NoError(err)
+	require.True(exists)
+
+	require.ErrorIs(d.Commit(), atomicpaths.ErrCommitted)
+	require.NoError(d.Close())
+}
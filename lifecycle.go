@@ -0,0 +1,59 @@
+// Copyright 2022 individual contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// <https://www.apache.org/licenses/LICENSE-2.0>
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package atomicpaths
+
+import "go.uber.org/multierr"
+
+// commitStep is one idempotent step of a create-write-commit-or-cancel
+// lifecycle, gated by a state bit. File and GenericFile both drive their
+// Commit and the uncommitted branch of Close through runCommitSteps and
+// runCloseSteps instead of repeating the same "skip it if its bit is
+// already set" bookkeeping inline, even though the steps themselves (how
+// many there are, and what each one does) differ between the two.
+type commitStep struct {
+	bit state
+	run func() error
+}
+
+// runCommitSteps runs the steps of steps whose bit is not yet set in *s,
+// in order, stopping at and returning the first error without setting
+// that step's bit. A later call with the same *s and steps resumes at
+// the step that failed.
+func runCommitSteps(s *state, steps []commitStep) error {
+	for _, step := range steps {
+		if s.is(step.bit) {
+			continue
+		}
+		if err := step.run(); err != nil {
+			return err
+		}
+		s.set(step.bit)
+	}
+	return nil
+}
+
+// runCloseSteps runs every step of steps whose bit is not yet set in *s,
+// collecting all of their errors instead of stopping at the first one:
+// unlike a commit, closing must still release whatever resources remain
+// even if an earlier step in the same call failed.
+func runCloseSteps(s *state, steps []commitStep) (err error) {
+	for _, step := range steps {
+		if !s.is(step.bit) {
+			multierr.AppendInto(&err, step.run())
+			s.set(step.bit)
+		}
+	}
+	return
+}
@@ -15,6 +15,7 @@
 package atomicpaths
 
 import (
+	"context"
 	"errors"
 	"io/fs"
 	"os"
@@ -22,16 +23,27 @@ import (
 )
 
 func renameToTemp(path string) (string, error) {
+	return renameToTempContext(context.Background(), path)
+}
+
+func renameToTempContext(ctx context.Context, path string) (string, error) {
+	dir := filepath.Dir(path)
+
 	for i := 0; i < 1000; i++ {
-		tempName, err := makeTempName(path + ".original")
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		tempName, err := makeTempName(filepath.Base(path) + ".original")
 		if err != nil {
 			return "", err
 		}
+		tempPath := filepath.Join(dir, tempName)
 
-		switch err := os.Rename(path, tempName); {
+		switch err := os.Rename(path, tempPath); {
 		case err == nil:
 			// File was renamed successfully.
-			return tempName, nil
+			return tempPath, nil
 		case err != nil && !errors.Is(err, fs.ErrExist):
 			// Renaming failed for a reason other than the target exists.
 			return "", err
@@ -41,7 +53,15 @@ func renameToTemp(path string) (string, error) {
 }
 
 func forceRemoveAll(p string) error {
+	return forceRemoveAllContext(context.Background(), p)
+}
+
+func forceRemoveAllContext(ctx context.Context, p string) error {
 	err := filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
 		if err != nil {
 			return err
 		}
@@ -66,6 +86,14 @@ func forceRemoveAll(p string) error {
 }
 
 func move(oldPath, newPath string) error {
+	return moveContext(context.Background(), oldPath, newPath)
+}
+
+func moveContext(ctx context.Context, oldPath, newPath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	switch err := os.Rename(oldPath, newPath); {
 	case err == nil:
 		// File was renamed successfully.
@@ -81,13 +109,13 @@ func move(oldPath, newPath string) error {
 	// oldPath to newPath and deleting the "original" newPath, the original
 	// file will still be available under the temporary name, so
 	// users can recover their data.
-	origTemp, err := renameToTemp(newPath)
+	origTemp, err := renameToTempContext(ctx, newPath)
 	if err != nil {
 		return err
 	}
 
-	if err := move(oldPath, newPath); err != nil {
+	if err := moveContext(ctx, oldPath, newPath); err != nil {
 		return err
 	}
-	return forceRemoveAll(origTemp)
+	return forceRemoveAllContext(ctx, origTemp)
 }
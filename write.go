@@ -0,0 +1,64 @@
+// Copyright 2022 individual contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// <https://www.apache.org/licenses/LICENSE-2.0>
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package atomicpaths
+
+import (
+	"io"
+	"os"
+
+	"go.uber.org/multierr"
+)
+
+// WriteFile durably replaces path with data, creating it if it does not
+// already exist. If the write or the rename into place fails, the
+// temporary file is discarded and the original path is left untouched;
+// if only the directory fsync after the rename fails, the error is
+// returned but the new content is already live at path.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	return ReplaceFile(path, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// ReplaceFile durably replaces path with whatever fn writes, creating it
+// if it does not already exist. fn is called with a writer backed by a
+// temporary file next to path; if fn returns an error the temporary file
+// is discarded, otherwise it is committed atomically to path.
+func ReplaceFile(path string, perm os.FileMode, fn func(io.Writer) error) error {
+	f, err := CreateFile(path, perm)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(f); err != nil {
+		return multierr.Append(err, f.Cancel())
+	}
+
+	if err := f.Commit(); err != nil {
+		// Commit can fail after it has already renamed the temporary
+		// file into place, e.g. when only the trailing directory
+		// fsync errors. At that point the new content is live at
+		// path, so Cancel — which implies the write was abandoned —
+		// would be a lie; Close releases the same resources without
+		// touching what Commit already placed.
+		if f.state.is(placed) {
+			return multierr.Append(err, f.Close())
+		}
+		return multierr.Append(err, f.Cancel())
+	}
+
+	return f.Close()
+}